@@ -2,14 +2,22 @@ package custom_commands
 
 import (
 	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/jesseduffield/lazygit/pkg/common"
+	"github.com/jesseduffield/lazygit/pkg/config"
 	"github.com/jesseduffield/lazygit/pkg/gui/style"
+	"gopkg.in/yaml.v3"
 )
 
 type MenuGenerator struct {
@@ -23,100 +31,525 @@ func NewMenuGenerator(c *common.Common) *MenuGenerator {
 }
 
 type commandMenuItem struct {
-	label string
-	value string
+	label       string
+	value       string
+	description string
 }
 
-func (self *MenuGenerator) call(commandOutput, filter, valueFormat, labelFormat string) ([]*commandMenuItem, error) {
-	menuItemFromLine, err := self.getMenuItemFromLinefn(filter, valueFormat, labelFormat)
+// menusDir is the subdirectory of the config dir that users can drop
+// predefined menu template files into, referenced from a custom command via
+// `menuFromFile: <name>.yaml`.
+const menusDir = "menus"
+
+// menuTemplateEntry is a single entry of a menu template file.
+type menuTemplateEntry struct {
+	Label       string `yaml:"label"`
+	Value       string `yaml:"value"`
+	Description string `yaml:"description"`
+	// Color is the name of one of the color template funcs registered by
+	// style.TemplateFuncMapAddColors (e.g. "red", "green", "cyan") and is
+	// applied to the label.
+	Color string `yaml:"color"`
+}
+
+// ErrTemplateLoad is returned when a menu template file under
+// ~/.config/lazygit/menus can't be read or parsed, and always identifies the
+// offending file so the user can find and fix it.
+type ErrTemplateLoad struct {
+	Filename string
+	Err      error
+}
+
+func (self *ErrTemplateLoad) Error() string {
+	return fmt.Sprintf("unable to load menu template file '%s': %s", self.Filename, self.Err)
+}
+
+func (self *ErrTemplateLoad) Unwrap() error {
+	return self.Err
+}
+
+// LoadMenuItemsFromFile reads a YAML file from ~/.config/lazygit/menus/<filename>
+// and returns its entries as menu items, with no command to run and no
+// filter/format templates to apply.
+func (self *MenuGenerator) LoadMenuItemsFromFile(filename string) ([]*commandMenuItem, error) {
+	path := filepath.Join(config.ConfigDir(), menusDir, filename)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ErrTemplateLoad{Filename: filename, Err: err}
+	}
+
+	var entries []menuTemplateEntry
+	if err := yaml.Unmarshal(content, &entries); err != nil {
+		return nil, &ErrTemplateLoad{Filename: filename, Err: err}
+	}
+
+	colorFuncMap := style.TemplateFuncMapAddColors(template.FuncMap{})
+
+	menuItems := make([]*commandMenuItem, 0, len(entries))
+	for _, entry := range entries {
+		label := entry.Label
+		if entry.Color != "" {
+			colored, err := self.applyColor(entry.Color, label, colorFuncMap)
+			if err != nil {
+				return nil, &ErrTemplateLoad{Filename: filename, Err: err}
+			}
+			label = colored
+		}
+
+		menuItems = append(menuItems, &commandMenuItem{
+			label:       label,
+			value:       entry.Value,
+			description: entry.Description,
+		})
+	}
+
+	return menuItems, nil
+}
+
+// applyColor renders `label` through the named color template func (e.g.
+// "red", "green") from the same func map used by valueFormat/labelFormat
+// templates.
+func (self *MenuGenerator) applyColor(color string, label string, colorFuncMap template.FuncMap) (string, error) {
+	tmpl, err := template.New("color").Funcs(colorFuncMap).Parse(fmt.Sprintf("{{ %s . }}", color))
+	if err != nil {
+		return "", errors.New("unable to parse color '" + color + "', error: " + err.Error())
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(buffer, label); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// output formats supported by MenuGenerator.call. "lines" (the default) keeps
+// the legacy behaviour of splitting stdout into lines and applying a filter
+// regex to each one; the others decode the command output into records before
+// the value/label templates are executed against them.
+const (
+	outputFormatLines = "lines"
+	outputFormatJson  = "json"
+	outputFormatYaml  = "yaml"
+	outputFormatCsv   = "csv"
+	outputFormatTsv   = "tsv"
+)
+
+// MenuGeneratorOptions controls post-processing of the generated menu items
+// that's independent of how each item's value/label was derived: removing
+// duplicates and imposing a deterministic order.
+type MenuGeneratorOptions struct {
+	// DedupeBy is "value", "label", a template expression (e.g.
+	// "{{ .group_1 }}") evaluated against the item's template data, or ""
+	// (the default) to keep every item.
+	DedupeBy string
+	// SortBy takes the same kinds of values as DedupeBy, plus "none" (the
+	// default) to preserve input order.
+	SortBy string
+	// SortOrder is "asc" (the default) or "desc", case-insensitive.
+	SortOrder string
+}
+
+const (
+	menuKeyByValue = "value"
+	menuKeyByLabel = "label"
+	menuSortByNone = "none"
+	sortOrderDesc  = "desc"
+)
+
+// menuItemCandidate pairs a generated menu item with the template data it was
+// derived from, so dedupeBy/sortBy can key on that data even though it's not
+// part of the final commandMenuItem.
+type menuItemCandidate struct {
+	item     *commandMenuItem
+	tmplData any
+}
+
+// defaultRecordSeparator is used to split the command output into records
+// when the user doesn't specify one.
+const defaultRecordSeparator = "\n"
+
+// MenuGeneratorSourceOptions controls how the raw command output is turned
+// into records before any filter/format template is applied.
+type MenuGeneratorSourceOptions struct {
+	// Format is one of outputFormatLines (the default), outputFormatJson,
+	// outputFormatYaml, outputFormatCsv or outputFormatTsv.
+	Format string
+	// RecordSeparator splits commandOutput into records when Format is
+	// "lines" (or unset); defaults to "\n".
+	RecordSeparator string
+	// Multiline compiles the filter regex with the (?s) flag, so that '.'
+	// matches newlines and named groups can span multiple physical lines
+	// within a record. Only applies when Format is "lines" (or unset).
+	Multiline bool
+}
+
+func (self *MenuGenerator) call(commandOutput, filter, valueFormat, labelFormat string, sourceOptions MenuGeneratorSourceOptions, options MenuGeneratorOptions) ([]*commandMenuItem, error) {
+	format := sourceOptions.Format
+	if format == "" {
+		format = outputFormatLines
+	}
+
+	if format != outputFormatLines {
+		return self.callStructured(commandOutput, valueFormat, labelFormat, format, options)
+	}
+
+	recordSeparator := sourceOptions.RecordSeparator
+	if recordSeparator == "" {
+		recordSeparator = defaultRecordSeparator
+	}
+
+	menuItemFromRecord, err := self.getMenuItemFromRecordfn(filter, valueFormat, labelFormat, sourceOptions.Multiline)
 	if err != nil {
 		return nil, err
 	}
 
-	menuItems := []*commandMenuItem{}
-	for _, line := range strings.Split(commandOutput, "\n") {
-		if line == "" {
+	candidates := []menuItemCandidate{}
+	for _, record := range strings.Split(commandOutput, recordSeparator) {
+		if record == "" {
 			continue
 		}
 
-		menuItem, err := menuItemFromLine(line)
+		menuItem, tmplData, err := menuItemFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, menuItemCandidate{item: menuItem, tmplData: tmplData})
+	}
+
+	return applyMenuGeneratorOptions(candidates, options)
+}
+
+// callStructured handles the json/yaml/csv/tsv formats: the command output is
+// decoded into a slice of records, and each record (rather than a regex
+// match) becomes the '.' of the value/label templates.
+func (self *MenuGenerator) callStructured(commandOutput, valueFormat, labelFormat, format string, options MenuGeneratorOptions) ([]*commandMenuItem, error) {
+	if valueFormat == "" {
+		// mirrors the "no filter/format -> show record as-is" convenience
+		// branch in getMenuItemFromRecordfn: with no valueFormat there's
+		// nothing to tell us what to extract from each decoded record, so
+		// fall back to the JSON-encoded record rather than silently
+		// producing a menu full of blank entries.
+		valueFormat = "{{ toJson . }}"
+	}
+
+	valueTemplate, labelTemplate, err := self.getFormatTemplates(valueFormat, labelFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := decodeStructuredRecords(commandOutput, format)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]menuItemCandidate, 0, len(records))
+	for _, record := range records {
+		entry := &commandMenuItem{}
+
+		entry.value, err = valueTemplate.execute(record)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.label, err = labelTemplate.execute(record)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, menuItemCandidate{item: entry, tmplData: record})
+	}
+
+	return applyMenuGeneratorOptions(candidates, options)
+}
+
+// applyMenuGeneratorOptions sorts and dedupes the candidates according to
+// options, then strips the template data back off to return plain menu
+// items.
+func applyMenuGeneratorOptions(candidates []menuItemCandidate, options MenuGeneratorOptions) ([]*commandMenuItem, error) {
+	sortBy := options.SortBy
+	if sortBy == "" {
+		sortBy = menuSortByNone
+	}
+
+	if sortBy != menuSortByNone {
+		keys, err := menuItemKeys(candidates, sortBy)
+		if err != nil {
+			return nil, err
+		}
+
+		indices := make([]int, len(candidates))
+		for i := range indices {
+			indices[i] = i
+		}
+		sort.SliceStable(indices, func(i, j int) bool {
+			if strings.EqualFold(options.SortOrder, sortOrderDesc) {
+				return keys[indices[i]] > keys[indices[j]]
+			}
+			return keys[indices[i]] < keys[indices[j]]
+		})
+
+		sorted := make([]menuItemCandidate, len(candidates))
+		for i, idx := range indices {
+			sorted[i] = candidates[idx]
+		}
+		candidates = sorted
+	}
+
+	if options.DedupeBy != "" {
+		keys, err := menuItemKeys(candidates, options.DedupeBy)
 		if err != nil {
 			return nil, err
 		}
-		menuItems = append(menuItems, menuItem)
+
+		deduped := make([]menuItemCandidate, 0, len(candidates))
+		seen := map[string]bool{}
+		for i, candidate := range candidates {
+			if seen[keys[i]] {
+				continue
+			}
+			seen[keys[i]] = true
+			deduped = append(deduped, candidate)
+		}
+		candidates = deduped
 	}
 
+	menuItems := make([]*commandMenuItem, 0, len(candidates))
+	for _, candidate := range candidates {
+		menuItems = append(menuItems, candidate.item)
+	}
 	return menuItems, nil
 }
 
-func (self *MenuGenerator) getMenuItemFromLinefn(filter string, valueFormat string, labelFormat string) (func(line string) (*commandMenuItem, error), error) {
+// menuItemKeys computes the dedupeBy/sortBy key for each candidate. keyBy is
+// "value", "label", or a template expression evaluated against the
+// candidate's template data.
+func menuItemKeys(candidates []menuItemCandidate, keyBy string) ([]string, error) {
+	switch keyBy {
+	case menuKeyByValue:
+		keys := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			keys[i] = candidate.item.value
+		}
+		return keys, nil
+	case menuKeyByLabel:
+		keys := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			keys[i] = candidate.item.label
+		}
+		return keys, nil
+	default:
+		tmplAux, err := template.New("key").Option("missingkey=zero").Parse(keyBy)
+		if err != nil {
+			return nil, errors.New("unable to parse key template, error: " + err.Error())
+		}
+		tmpl := NewTrimmerTemplate(tmplAux)
+
+		keys := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			key, err := tmpl.execute(candidate.tmplData)
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = key
+		}
+		return keys, nil
+	}
+}
+
+// decodeStructuredRecords turns the raw command output into a slice of
+// records to be passed to the value/label templates. For 'json' it accepts
+// either a top-level array or newline-delimited JSON objects; for 'yaml' it
+// accepts a YAML sequence; for 'csv'/'tsv' the first row is treated as the
+// column headers and each subsequent row becomes a map keyed by header name.
+func decodeStructuredRecords(commandOutput, format string) ([]any, error) {
+	switch format {
+	case outputFormatJson:
+		return decodeJsonRecords(commandOutput)
+	case outputFormatYaml:
+		var records []any
+		if err := yaml.Unmarshal([]byte(commandOutput), &records); err != nil {
+			return nil, errors.New("unable to parse command output as yaml, error: " + err.Error())
+		}
+		return records, nil
+	case outputFormatCsv:
+		return decodeDelimitedRecords(commandOutput, ',')
+	case outputFormatTsv:
+		return decodeDelimitedRecords(commandOutput, '\t')
+	default:
+		return nil, errors.New("unknown format: " + format)
+	}
+}
+
+func decodeJsonRecords(commandOutput string) ([]any, error) {
+	trimmed := strings.TrimSpace(commandOutput)
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	if trimmed[0] == '[' {
+		var records []any
+		if err := json.Unmarshal([]byte(trimmed), &records); err != nil {
+			return nil, errors.New("unable to parse command output as json, error: " + err.Error())
+		}
+		return records, nil
+	}
+
+	// newline-delimited JSON: one object per line
+	records := []any{}
+	for _, line := range strings.Split(trimmed, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var record any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, errors.New("unable to parse command output as newline-delimited json, error: " + err.Error())
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func decodeDelimitedRecords(commandOutput string, comma rune) ([]any, error) {
+	reader := csv.NewReader(strings.NewReader(commandOutput))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.New("unable to parse command output as delimited data, error: " + err.Error())
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	headers := rows[0]
+	records := make([]any, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := map[string]string{}
+		for i, header := range headers {
+			if i < len(row) {
+				record[header] = row[i]
+			} else {
+				record[header] = ""
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// getMenuItemFromRecordfn returns a function that turns one record (by
+// default a single line, but see recordSeparator on call) into a menu item.
+// With multiline set, the filter regex is compiled with the (?s) flag so
+// that '.' matches newlines and named groups can span multiple physical
+// lines within the record.
+func (self *MenuGenerator) getMenuItemFromRecordfn(filter string, valueFormat string, labelFormat string, multiline bool) (func(record string) (*commandMenuItem, map[string]string, error), error) {
 	if filter == "" && valueFormat == "" && labelFormat == "" {
-		// showing command output lines as-is in suggestions panel
-		return func(line string) (*commandMenuItem, error) {
-			return &commandMenuItem{label: line, value: line}, nil
+		// showing command output records as-is in suggestions panel. The
+		// returned tmplData is an empty map, so dedupeBy/sortBy template
+		// expressions evaluated against it render every field lookup as "".
+		return func(record string) (*commandMenuItem, map[string]string, error) {
+			return &commandMenuItem{label: record, value: record}, map[string]string{}, nil
 		}, nil
 	}
 
+	if multiline {
+		filter = "(?s)" + filter
+	}
+
 	regex, err := regexp.Compile(filter)
 	if err != nil {
 		return nil, errors.New("unable to parse filter regex, error: " + err.Error())
 	}
 
-	valueTemplateAux, err := template.New("format").Parse(valueFormat)
+	valueTemplate, labelTemplate, err := self.getFormatTemplates(valueFormat, labelFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(record string) (*commandMenuItem, map[string]string, error) {
+		return self.generateMenuItem(
+			record,
+			regex,
+			valueTemplate,
+			labelTemplate,
+		)
+	}, nil
+}
+
+// getFormatTemplates parses the user-provided value/label format strings,
+// falling back to the value template for the label when no label format was
+// given.
+func (self *MenuGenerator) getFormatTemplates(valueFormat string, labelFormat string) (*TrimmerTemplate, *TrimmerTemplate, error) {
+	funcMap := jsonTemplateFuncMap()
+
+	valueTemplateAux, err := template.New("format").Funcs(funcMap).Option("missingkey=zero").Parse(valueFormat)
 	if err != nil {
-		return nil, errors.New("unable to parse value format, error: " + err.Error())
+		return nil, nil, errors.New("unable to parse value format, error: " + err.Error())
 	}
 	valueTemplate := NewTrimmerTemplate(valueTemplateAux)
 
 	var labelTemplate *TrimmerTemplate
 	if labelFormat != "" {
-		colorFuncMap := style.TemplateFuncMapAddColors(template.FuncMap{})
-		labelTemplateAux, err := template.New("format").Funcs(colorFuncMap).Parse(labelFormat)
+		colorFuncMap := style.TemplateFuncMapAddColors(funcMap)
+		labelTemplateAux, err := template.New("format").Funcs(colorFuncMap).Option("missingkey=zero").Parse(labelFormat)
 		if err != nil {
-			return nil, errors.New("unable to parse label format, error: " + err.Error())
+			return nil, nil, errors.New("unable to parse label format, error: " + err.Error())
 		}
 		labelTemplate = NewTrimmerTemplate(labelTemplateAux)
 	} else {
 		labelTemplate = valueTemplate
 	}
 
-	return func(line string) (*commandMenuItem, error) {
-		return self.generateMenuItem(
-			line,
-			regex,
-			valueTemplate,
-			labelTemplate,
-		)
-	}, nil
+	return valueTemplate, labelTemplate, nil
+}
+
+// jsonTemplateFuncMap provides the "toJson" template func used as the
+// fallback value/label format for structured command output when the user
+// doesn't specify one (see callStructured).
+func jsonTemplateFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"toJson": func(v any) (string, error) {
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return string(encoded), nil
+		},
+	}
 }
 
 func (self *MenuGenerator) generateMenuItem(
-	line string,
+	record string,
 	regex *regexp.Regexp,
 	valueTemplate *TrimmerTemplate,
 	labelTemplate *TrimmerTemplate,
-) (*commandMenuItem, error) {
-	tmplData := self.parseLine(line, regex)
+) (*commandMenuItem, map[string]string, error) {
+	tmplData := self.parseRecord(record, regex)
 
 	entry := &commandMenuItem{}
 
 	var err error
 	entry.value, err = valueTemplate.execute(tmplData)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	entry.label, err = labelTemplate.execute(tmplData)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return entry, nil
+	return entry, tmplData, nil
 }
 
-func (self *MenuGenerator) parseLine(line string, regex *regexp.Regexp) map[string]string {
+func (self *MenuGenerator) parseRecord(record string, regex *regexp.Regexp) map[string]string {
 	tmplData := map[string]string{}
-	out := regex.FindAllStringSubmatch(line, -1)
+	out := regex.FindAllStringSubmatch(record, -1)
 	if len(out) > 0 {
 		for groupIdx, group := range regex.SubexpNames() {
 			// Record matched group with group ids
@@ -145,7 +578,7 @@ func NewTrimmerTemplate(template *template.Template) *TrimmerTemplate {
 	}
 }
 
-func (self *TrimmerTemplate) execute(tmplData map[string]string) (string, error) {
+func (self *TrimmerTemplate) execute(tmplData any) (string, error) {
 	self.buffer.Reset()
 	err := self.template.Execute(self.buffer, tmplData)
 	if err != nil {
@@ -0,0 +1,367 @@
+package custom_commands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeStructuredRecords(t *testing.T) {
+	scenarios := []struct {
+		testName string
+		output   string
+		format   string
+		want     []any
+		wantErr  bool
+	}{
+		{
+			testName: "json array",
+			output:   `[{"name": "a"}, {"name": "b"}]`,
+			format:   outputFormatJson,
+			want: []any{
+				map[string]any{"name": "a"},
+				map[string]any{"name": "b"},
+			},
+		},
+		{
+			testName: "newline-delimited json",
+			output:   "{\"name\": \"a\"}\n{\"name\": \"b\"}\n",
+			format:   outputFormatJson,
+			want: []any{
+				map[string]any{"name": "a"},
+				map[string]any{"name": "b"},
+			},
+		},
+		{
+			testName: "invalid json",
+			output:   "{not json}",
+			format:   outputFormatJson,
+			wantErr:  true,
+		},
+		{
+			testName: "yaml sequence",
+			output:   "- name: a\n- name: b\n",
+			format:   outputFormatYaml,
+			want: []any{
+				map[string]any{"name": "a"},
+				map[string]any{"name": "b"},
+			},
+		},
+		{
+			testName: "csv with headers",
+			output:   "name,age\na,1\nb,2\n",
+			format:   outputFormatCsv,
+			want: []any{
+				map[string]string{"name": "a", "age": "1"},
+				map[string]string{"name": "b", "age": "2"},
+			},
+		},
+		{
+			testName: "csv with ragged row",
+			output:   "name,age,note\na,1\n",
+			format:   outputFormatCsv,
+			want: []any{
+				map[string]string{"name": "a", "age": "1", "note": ""},
+			},
+		},
+		{
+			testName: "tsv with headers",
+			output:   "name\tage\na\t1\n",
+			format:   outputFormatTsv,
+			want: []any{
+				map[string]string{"name": "a", "age": "1"},
+			},
+		},
+		{
+			testName: "unknown format",
+			output:   "anything",
+			format:   "xml",
+			wantErr:  true,
+		},
+	}
+
+	for _, s := range scenarios {
+		s := s
+		t.Run(s.testName, func(t *testing.T) {
+			got, err := decodeStructuredRecords(s.output, s.format)
+			if s.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(got) != len(s.want) {
+				t.Fatalf("got %d records, want %d: %#v", len(got), len(s.want), got)
+			}
+			for i := range got {
+				gotRecord := toStringMap(got[i])
+				wantRecord := toStringMap(s.want[i])
+				for k, v := range wantRecord {
+					if gotRecord[k] != v {
+						t.Errorf("record %d: key %q: got %q, want %q", i, k, gotRecord[k], v)
+					}
+				}
+			}
+		})
+	}
+}
+
+// toStringMap normalizes map[string]any and map[string]string into
+// map[string]string so the json/yaml/csv/tsv decoders can be compared with
+// the same assertion logic.
+func toStringMap(v any) map[string]string {
+	result := map[string]string{}
+	switch m := v.(type) {
+	case map[string]any:
+		for k, val := range m {
+			result[k] = toStringValue(val)
+		}
+	case map[string]string:
+		for k, val := range m {
+			result[k] = val
+		}
+	}
+	return result
+}
+
+func toStringValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func TestCallStructuredDefaultsValueFormatToJson(t *testing.T) {
+	generator := NewMenuGenerator(nil)
+
+	items, err := generator.callStructured(`[{"name": "a"}]`, "", "", outputFormatJson, MenuGeneratorOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+	if items[0].value != `{"name":"a"}` {
+		t.Errorf("got value %q, want JSON-encoded record", items[0].value)
+	}
+	if items[0].label != items[0].value {
+		t.Errorf("expected label to default to value, got label %q value %q", items[0].label, items[0].value)
+	}
+}
+
+func TestCallStructuredWithValueFormat(t *testing.T) {
+	generator := NewMenuGenerator(nil)
+
+	items, err := generator.callStructured(`[{"name": "a"}, {"name": "b"}]`, "{{ .name }}", "", outputFormatJson, MenuGeneratorOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(items) != 2 || items[0].value != "a" || items[1].value != "b" {
+		t.Fatalf("unexpected items: %#v", items)
+	}
+}
+
+func TestLoadMenuItemsFromFile(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	menusDirPath := filepath.Join(configHome, "lazygit", menusDir)
+	if err := os.MkdirAll(menusDirPath, 0o755); err != nil {
+		t.Fatalf("failed to create menus dir: %v", err)
+	}
+
+	content := "- label: Feature branch\n" +
+		"  value: feature/\n" +
+		"  description: for new work\n"
+	if err := os.WriteFile(filepath.Join(menusDirPath, "branch-prefixes.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write menu template file: %v", err)
+	}
+
+	generator := NewMenuGenerator(nil)
+	items, err := generator.LoadMenuItemsFromFile("branch-prefixes.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+	if items[0].label != "Feature branch" || items[0].value != "feature/" || items[0].description != "for new work" {
+		t.Errorf("unexpected item: %#v", items[0])
+	}
+}
+
+func TestLoadMenuItemsFromFileMissing(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	generator := NewMenuGenerator(nil)
+	_, err := generator.LoadMenuItemsFromFile("does-not-exist.yaml")
+	if err == nil {
+		t.Fatal("expected an error for a missing menu template file")
+	}
+
+	var loadErr *ErrTemplateLoad
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("expected an *ErrTemplateLoad, got %T: %v", err, err)
+	}
+	if loadErr.Filename != "does-not-exist.yaml" {
+		t.Errorf("expected error to reference the filename, got %q", loadErr.Filename)
+	}
+}
+
+func TestApplyMenuGeneratorOptionsDedupeAndSort(t *testing.T) {
+	candidates := []menuItemCandidate{
+		{item: &commandMenuItem{value: "b", label: "B"}, tmplData: map[string]string{"group_1": "x"}},
+		{item: &commandMenuItem{value: "a", label: "A"}, tmplData: map[string]string{"group_1": "y"}},
+		{item: &commandMenuItem{value: "b", label: "B (dup)"}, tmplData: map[string]string{"group_1": "x"}},
+	}
+
+	t.Run("sortBy value ascending", func(t *testing.T) {
+		got, err := applyMenuGeneratorOptions(candidates, MenuGeneratorOptions{SortBy: menuKeyByValue})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 3 || got[0].value != "a" || got[1].value != "b" {
+			t.Fatalf("unexpected order: %#v", got)
+		}
+	})
+
+	t.Run("sortBy value descending", func(t *testing.T) {
+		got, err := applyMenuGeneratorOptions(candidates, MenuGeneratorOptions{SortBy: menuKeyByValue, SortOrder: "DESC"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got[0].value != "b" || got[len(got)-1].value != "a" {
+			t.Fatalf("unexpected order: %#v", got)
+		}
+	})
+
+	t.Run("dedupeBy value keeps first occurrence", func(t *testing.T) {
+		got, err := applyMenuGeneratorOptions(candidates, MenuGeneratorOptions{DedupeBy: menuKeyByValue})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("expected 2 deduped items, got %d: %#v", len(got), got)
+		}
+		if got[0].label != "B" {
+			t.Errorf("expected first occurrence 'B' to be kept, got %q", got[0].label)
+		}
+	})
+
+	t.Run("dedupeBy template expression", func(t *testing.T) {
+		got, err := applyMenuGeneratorOptions(candidates, MenuGeneratorOptions{DedupeBy: "{{ .group_1 }}"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("expected 2 deduped items, got %d: %#v", len(got), got)
+		}
+	})
+}
+
+func TestApplyMenuGeneratorOptionsTemplateExprAgainstEmptyTmplData(t *testing.T) {
+	// as-is menu items (no filter/format) carry an empty, non-nil tmplData
+	// (see getMenuItemFromRecordfn); dedupeBy/sortBy template expressions
+	// must degrade gracefully against it instead of erroring.
+	candidates := []menuItemCandidate{
+		{item: &commandMenuItem{value: "a", label: "a"}, tmplData: map[string]string{}},
+		{item: &commandMenuItem{value: "b", label: "b"}, tmplData: map[string]string{}},
+	}
+
+	got, err := applyMenuGeneratorOptions(candidates, MenuGeneratorOptions{DedupeBy: "{{ .missing }}"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected both items to dedupe to the same empty key, got %d: %#v", len(got), got)
+	}
+}
+
+func TestCallWithCustomRecordSeparator(t *testing.T) {
+	generator := NewMenuGenerator(nil)
+
+	output := "one\n---\ntwo\n---\nthree"
+	items, err := generator.call(output, "", "", "", MenuGeneratorSourceOptions{RecordSeparator: "\n---\n"}, MenuGeneratorOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("expected 3 records, got %d: %#v", len(items), items)
+	}
+	if items[0].value != "one" || items[1].value != "two" || items[2].value != "three" {
+		t.Fatalf("unexpected values: %#v", items)
+	}
+}
+
+// multilineFilter only matches a record whose "title: ..." and "body: ..."
+// lines are bridged by '.' crossing the newline between them, so it only
+// matches once (?s) is in effect.
+const multilineFilter = `title: .*body: (?P<body>.*)`
+
+func TestCallWithMultilineFilter(t *testing.T) {
+	generator := NewMenuGenerator(nil)
+
+	record1 := "title: hello\nbody: world"
+	record2 := "title: foo\nbody: bar"
+	output := record1 + "\x00" + record2
+
+	items, err := generator.call(
+		output,
+		multilineFilter,
+		"{{ .body }}",
+		"",
+		MenuGeneratorSourceOptions{RecordSeparator: "\x00", Multiline: true},
+		MenuGeneratorOptions{},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("expected 2 records, got %d: %#v", len(items), items)
+	}
+	if items[0].value != "world" {
+		t.Errorf("got %q, want %q", items[0].value, "world")
+	}
+	if items[1].value != "bar" {
+		t.Errorf("got %q, want %q", items[1].value, "bar")
+	}
+}
+
+func TestCallWithoutMultilineDoesNotMatchAcrossLines(t *testing.T) {
+	generator := NewMenuGenerator(nil)
+
+	// same filter and record as TestCallWithMultilineFilter, kept intact via
+	// a custom recordSeparator, but without Multiline the '.' in the regex
+	// can't cross the "\n" between "title" and "body" so it shouldn't match.
+	// A non-matching group must render as "" (missingkey=zero on the
+	// template), not the text/template default "<no value>".
+	record := "title: hello\nbody: world"
+	items, err := generator.call(
+		record,
+		multilineFilter,
+		"{{ .body }}",
+		"",
+		MenuGeneratorSourceOptions{RecordSeparator: "\x00"},
+		MenuGeneratorOptions{},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(items) != 1 {
+		t.Fatalf("expected 1 record, got %d: %#v", len(items), items)
+	}
+	if items[0].value != "" {
+		t.Errorf("expected no match without multiline mode to produce an empty value, got %q", items[0].value)
+	}
+}